@@ -0,0 +1,19 @@
+package main
+
+import (
+	"context"
+
+	"github.com/rexray/gocsi"
+
+	"github.com/thecodeteam/csi-vfs/provider"
+	"github.com/thecodeteam/csi-vfs/service"
+)
+
+func main() {
+	gocsi.Run(
+		context.Background(),
+		service.Name,
+		"A VFS Container Storage Interface (CSI) Storage Plug-in (SP)",
+		"",
+		provider.New())
+}
@@ -0,0 +1,331 @@
+// Package docker implements the Docker Volume Plugin protocol
+// (https://docs.docker.com/engine/extend/plugins_volume/) on top of the
+// same service.Service backend used by the CSI gRPC endpoint, allowing
+// csi-vfs volumes to be mounted directly into plain Docker containers.
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/rexray/gocsi"
+
+	"github.com/thecodeteam/csi-vfs/service"
+)
+
+const (
+	contentType = "application/vnd.docker.plugins.v1.1+json"
+
+	// SockPath is the default path of the Unix socket on which the
+	// Docker Volume Plugin HTTP server listens.
+	SockPath = "/run/docker/plugins/csi-vfs.sock"
+
+	// MountRoot is the default directory under which volumes are bind
+	// mounted for Docker containers.
+	MountRoot = "/run/docker/csi-vfs/mounts"
+)
+
+// Plugin adapts a service.Service to the Docker Volume Plugin protocol.
+type Plugin struct {
+	svc       service.Service
+	sockPath  string
+	mountRoot string
+
+	mu     sync.Mutex
+	mounts map[string]map[string]bool // volume name -> set of mounter IDs
+}
+
+// New returns a new Docker Volume Plugin adapter around svc.
+func New(svc service.Service) *Plugin {
+	return &Plugin{
+		svc:       svc,
+		sockPath:  SockPath,
+		mountRoot: MountRoot,
+		mounts:    map[string]map[string]bool{},
+	}
+}
+
+// BeforeServe implements the same signature as service.Service's
+// BeforeServe so it can be used as a drop-in, alternative entry point.
+// It first delegates to the wrapped service's own BeforeServe to
+// initialize its directories and configuration, and then starts the
+// Docker Volume Plugin HTTP server alongside the gRPC listener.
+func (p *Plugin) BeforeServe(
+	ctx context.Context, sp *gocsi.StoragePlugin, lis net.Listener) error {
+
+	if err := p.svc.BeforeServe(ctx, sp, lis); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(p.mountRoot, 0755); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(p.sockPath), 0755); err != nil {
+		return err
+	}
+	os.Remove(p.sockPath)
+
+	sockLis, err := net.Listen("unix", p.sockPath)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		log.WithField("sockPath", p.sockPath).Info(
+			"serving docker volume plugin")
+		if err := http.Serve(sockLis, p.mux()); err != nil {
+			log.WithError(err).Error("docker volume plugin server exited")
+		}
+	}()
+
+	return nil
+}
+
+func (p *Plugin) mux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/Plugin.Activate", p.handleActivate)
+	mux.HandleFunc("/VolumeDriver.Create", p.handleCreate)
+	mux.HandleFunc("/VolumeDriver.Get", p.handleGet)
+	mux.HandleFunc("/VolumeDriver.List", p.handleList)
+	mux.HandleFunc("/VolumeDriver.Remove", p.handleRemove)
+	mux.HandleFunc("/VolumeDriver.Path", p.handlePath)
+	mux.HandleFunc("/VolumeDriver.Mount", p.handleMount)
+	mux.HandleFunc("/VolumeDriver.Unmount", p.handleUnmount)
+	mux.HandleFunc("/VolumeDriver.Capabilities", p.handleCapabilities)
+	return mux
+}
+
+type dockerVolume struct {
+	Name       string            `json:"Name"`
+	Mountpoint string            `json:"Mountpoint,omitempty"`
+	Status     map[string]string `json:"Status,omitempty"`
+}
+
+type errResponse struct {
+	Err string `json:"Err"`
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", contentType)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeErr(w http.ResponseWriter, err error) {
+	writeJSON(w, errResponse{Err: err.Error()})
+}
+
+func decode(r *http.Request, v interface{}) error {
+	defer r.Body.Close()
+	return json.NewDecoder(r.Body).Decode(v)
+}
+
+func (p *Plugin) handleActivate(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, struct {
+		Implements []string
+	}{Implements: []string{"VolumeDriver"}})
+}
+
+func (p *Plugin) handleCapabilities(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, struct {
+		Capabilities struct {
+			Scope string `json:"Scope"`
+		} `json:"Capabilities"`
+	}{})
+}
+
+func (p *Plugin) handleCreate(w http.ResponseWriter, r *http.Request) {
+	req := struct {
+		Name string
+		Opts map[string]string
+	}{}
+	if err := decode(r, &req); err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	params := make(map[string]string, len(req.Opts))
+	for k, v := range req.Opts {
+		params[k] = v
+	}
+
+	_, err := p.svc.CreateVolume(r.Context(), &csi.CreateVolumeRequest{
+		Name:       req.Name,
+		Parameters: params,
+	})
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	writeJSON(w, errResponse{})
+}
+
+func (p *Plugin) handleRemove(w http.ResponseWriter, r *http.Request) {
+	req := struct{ Name string }{}
+	if err := decode(r, &req); err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	_, err := p.svc.DeleteVolume(r.Context(), &csi.DeleteVolumeRequest{
+		VolumeId: req.Name,
+	})
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	writeJSON(w, errResponse{})
+}
+
+func (p *Plugin) handlePath(w http.ResponseWriter, r *http.Request) {
+	req := struct{ Name string }{}
+	if err := decode(r, &req); err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	writeJSON(w, struct {
+		Mountpoint string
+		Err        string
+	}{Mountpoint: p.mountPath(req.Name)})
+}
+
+func (p *Plugin) handleGet(w http.ResponseWriter, r *http.Request) {
+	req := struct{ Name string }{}
+	if err := decode(r, &req); err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	writeJSON(w, struct {
+		Volume dockerVolume
+		Err    string
+	}{Volume: dockerVolume{
+		Name:       req.Name,
+		Mountpoint: p.mountPath(req.Name),
+	}})
+}
+
+func (p *Plugin) handleList(w http.ResponseWriter, r *http.Request) {
+	resp, err := p.svc.ListVolumes(r.Context(), &csi.ListVolumesRequest{})
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	vols := make([]dockerVolume, len(resp.Entries))
+	for i, e := range resp.Entries {
+		vols[i] = dockerVolume{
+			Name:       e.Volume.VolumeId,
+			Mountpoint: p.mountPath(e.Volume.VolumeId),
+		}
+	}
+
+	writeJSON(w, struct {
+		Volumes []dockerVolume
+		Err     string
+	}{Volumes: vols})
+}
+
+func (p *Plugin) handleMount(w http.ResponseWriter, r *http.Request) {
+	req := struct{ Name, ID string }{}
+	if err := decode(r, &req); err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	target := p.mountPath(req.Name)
+
+	p.mu.Lock()
+	alreadyMounted := p.mounts[req.Name][req.ID]
+	refs := addMounter(p.mounts, req.Name, req.ID)
+	p.mu.Unlock()
+
+	if refs == 1 && !alreadyMounted {
+		if err := os.MkdirAll(target, 0755); err != nil {
+			writeErr(w, err)
+			return
+		}
+		_, err := p.svc.NodePublishVolume(r.Context(), &csi.NodePublishVolumeRequest{
+			VolumeId:   req.Name,
+			TargetPath: target,
+		})
+		if err != nil {
+			writeErr(w, err)
+			return
+		}
+	}
+
+	writeJSON(w, struct {
+		Mountpoint string
+		Err        string
+	}{Mountpoint: target})
+}
+
+func (p *Plugin) handleUnmount(w http.ResponseWriter, r *http.Request) {
+	req := struct{ Name, ID string }{}
+	if err := decode(r, &req); err != nil {
+		writeErr(w, err)
+		return
+	}
+
+	p.mu.Lock()
+	refs := removeMounter(p.mounts, req.Name, req.ID)
+	p.mu.Unlock()
+
+	if refs == 0 {
+		_, err := p.svc.NodeUnpublishVolume(r.Context(), &csi.NodeUnpublishVolumeRequest{
+			VolumeId:   req.Name,
+			TargetPath: p.mountPath(req.Name),
+		})
+		if err != nil {
+			writeErr(w, err)
+			return
+		}
+	}
+
+	writeJSON(w, errResponse{})
+}
+
+func (p *Plugin) mountPath(name string) string {
+	return path.Join(p.mountRoot, name)
+}
+
+// addMounter records that mounter id is using volume name, returning the
+// number of distinct mounters for that volume after the addition. The
+// caller should only bind mount when this was the first mounter.
+func addMounter(mounts map[string]map[string]bool, name, id string) int {
+	mounters, ok := mounts[name]
+	if !ok {
+		mounters = map[string]bool{}
+		mounts[name] = mounters
+	}
+	mounters[id] = true
+	return len(mounters)
+}
+
+// removeMounter forgets that mounter id is using volume name, returning
+// the number of distinct mounters for that volume after the removal. The
+// caller should only unmount when this drops to zero. Removing an id
+// that was never added, or removing from an unknown volume, is a no-op.
+func removeMounter(mounts map[string]map[string]bool, name, id string) int {
+	mounters, ok := mounts[name]
+	if !ok {
+		return 0
+	}
+	delete(mounters, id)
+	if len(mounters) == 0 {
+		delete(mounts, name)
+		return 0
+	}
+	return len(mounters)
+}
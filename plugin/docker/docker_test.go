@@ -0,0 +1,39 @@
+package docker
+
+import "testing"
+
+func TestAddRemoveMounterPerID(t *testing.T) {
+	mounts := map[string]map[string]bool{}
+
+	if refs := addMounter(mounts, "vol1", "containerA"); refs != 1 {
+		t.Fatalf("expected 1 ref after first mount, got %d", refs)
+	}
+
+	// A second mount call with the same ID (e.g. a Docker retry) must
+	// not inflate the refcount.
+	if refs := addMounter(mounts, "vol1", "containerA"); refs != 1 {
+		t.Fatalf("expected 1 ref after duplicate mount by same id, got %d", refs)
+	}
+
+	if refs := addMounter(mounts, "vol1", "containerB"); refs != 2 {
+		t.Fatalf("expected 2 refs after second container mounts, got %d", refs)
+	}
+
+	// Unmounting an ID that never mounted must not affect other
+	// mounters' refs.
+	if refs := removeMounter(mounts, "vol1", "containerC"); refs != 2 {
+		t.Fatalf("expected 2 refs after unknown unmount, got %d", refs)
+	}
+
+	if refs := removeMounter(mounts, "vol1", "containerA"); refs != 1 {
+		t.Fatalf("expected 1 ref after containerA unmounts, got %d", refs)
+	}
+
+	if refs := removeMounter(mounts, "vol1", "containerB"); refs != 0 {
+		t.Fatalf("expected 0 refs after last mounter unmounts, got %d", refs)
+	}
+
+	if _, ok := mounts["vol1"]; ok {
+		t.Fatal("expected volume entry to be cleaned up once unreferenced")
+	}
+}
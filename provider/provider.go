@@ -0,0 +1,40 @@
+// Package provider assembles the csi-vfs gocsi.StoragePluginProvider used
+// by the plugin's main package.
+package provider
+
+import (
+	"context"
+	"net"
+
+	"github.com/rexray/gocsi"
+	csictx "github.com/rexray/gocsi/context"
+
+	"github.com/thecodeteam/csi-vfs/plugin/docker"
+	"github.com/thecodeteam/csi-vfs/service"
+)
+
+// New returns a new csi-vfs Storage Plug-in Provider. If
+// service.EnvVarDockerPlugin is set to "true", the returned provider
+// serves the Docker Volume Plugin HTTP API alongside the CSI gRPC
+// listener; otherwise it serves the CSI gRPC listener only.
+func New() gocsi.StoragePluginProvider {
+	svc := service.New()
+	beforeServe := svc.BeforeServe
+
+	return &gocsi.StoragePlugin{
+		Controller: svc,
+		Identity:   svc,
+		Node:       svc,
+
+		BeforeServe: func(
+			ctx context.Context,
+			sp *gocsi.StoragePlugin,
+			lis net.Listener) error {
+
+			if v, ok := csictx.LookupEnv(ctx, service.EnvVarDockerPlugin); ok && v == "true" {
+				beforeServe = docker.New(svc).BeforeServe
+			}
+			return beforeServe(ctx, sp, lis)
+		},
+	}
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+// controllerCapabilities is the list of capabilities advertised by the
+// controller service.
+var controllerCapabilities = []*csi.ControllerServiceCapability{
+	newControllerCap(csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME),
+	newControllerCap(csi.ControllerServiceCapability_RPC_EXPAND_VOLUME),
+	newControllerCap(csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT),
+	newControllerCap(csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS),
+}
+
+// nodeCapabilities is the list of capabilities advertised by the node
+// service.
+var nodeCapabilities = []*csi.NodeServiceCapability{
+	newNodeCap(csi.NodeServiceCapability_RPC_EXPAND_VOLUME),
+}
+
+func newControllerCap(
+	cap csi.ControllerServiceCapability_RPC_Type) *csi.ControllerServiceCapability {
+
+	return &csi.ControllerServiceCapability{
+		Type: &csi.ControllerServiceCapability_Rpc{
+			Rpc: &csi.ControllerServiceCapability_RPC{
+				Type: cap,
+			},
+		},
+	}
+}
+
+func newNodeCap(
+	cap csi.NodeServiceCapability_RPC_Type) *csi.NodeServiceCapability {
+
+	return &csi.NodeServiceCapability{
+		Type: &csi.NodeServiceCapability_Rpc{
+			Rpc: &csi.NodeServiceCapability_RPC{
+				Type: cap,
+			},
+		},
+	}
+}
+
+func (s *service) ControllerGetCapabilities(
+	ctx context.Context,
+	req *csi.ControllerGetCapabilitiesRequest) (
+	*csi.ControllerGetCapabilitiesResponse, error) {
+
+	return &csi.ControllerGetCapabilitiesResponse{
+		Capabilities: controllerCapabilities,
+	}, nil
+}
+
+func (s *service) NodeGetCapabilities(
+	ctx context.Context,
+	req *csi.NodeGetCapabilitiesRequest) (
+	*csi.NodeGetCapabilitiesResponse, error) {
+
+	return &csi.NodeGetCapabilitiesResponse{
+		Capabilities: nodeCapabilities,
+	}, nil
+}
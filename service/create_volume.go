@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+func (s *service) CreateVolume(
+	ctx context.Context,
+	req *csi.CreateVolumeRequest) (
+	*csi.CreateVolumeResponse, error) {
+
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing volume name")
+	}
+
+	if vol, err := s.getVolume(req.Name); err == nil {
+		return &csi.CreateVolumeResponse{Volume: vol.toCSIVolInfo()}, nil
+	}
+
+	volPath := path.Join(s.vol, req.Name)
+	if err := os.MkdirAll(volPath, 0755); err != nil {
+		return nil, status.Errorf(codes.Internal,
+			"failed to create volume %s: %v", req.Name, err)
+	}
+
+	var capacityBytes int64
+	if cr := req.CapacityRange; cr != nil {
+		capacityBytes = cr.RequiredBytes
+	}
+
+	vol := &volumeInfo{
+		path:                volPath,
+		infoPath:            path.Join(volPath, infoFileName),
+		capacityBytes:       capacityBytes,
+		CreateVolumeRequest: *req,
+	}
+
+	// applyQuota must run before restoreSnapshot: for quota_mode=loopback
+	// it mounts a fresh filesystem image over volPath, which would
+	// otherwise shadow whatever restoreSnapshot had just copied there.
+	if err := s.applyQuota(ctx, vol); err != nil {
+		os.RemoveAll(volPath)
+		return nil, err
+	}
+
+	if src := req.VolumeContentSource; src != nil {
+		if snap := src.GetSnapshot(); snap != nil {
+			if err := s.restoreSnapshot(snap.SnapshotId, volPath); err != nil {
+				s.teardownQuota(ctx, vol)
+				os.RemoveAll(volPath)
+				return nil, status.Errorf(codes.Internal,
+					"failed to restore snapshot %s into volume %s: %v",
+					snap.SnapshotId, req.Name, err)
+			}
+		}
+	}
+
+	if err := vol.save(); err != nil {
+		s.teardownQuota(ctx, vol)
+		os.RemoveAll(volPath)
+		return nil, err
+	}
+
+	log.WithFields(map[string]interface{}{
+		"name": req.Name,
+		"size": capacityBytes,
+	}).Info("created volume")
+
+	return &csi.CreateVolumeResponse{Volume: vol.toCSIVolInfo()}, nil
+}
+
+func (s *service) DeleteVolume(
+	ctx context.Context,
+	req *csi.DeleteVolumeRequest) (
+	*csi.DeleteVolumeResponse, error) {
+
+	if req.VolumeId == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing volume id")
+	}
+
+	vol, err := s.getVolume(req.VolumeId)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return &csi.DeleteVolumeResponse{}, nil
+		}
+		return nil, err
+	}
+
+	if err := s.teardownQuota(ctx, vol); err != nil {
+		return nil, err
+	}
+
+	if err := os.RemoveAll(vol.path); err != nil {
+		return nil, status.Errorf(codes.Internal,
+			"failed to delete volume %s: %v", req.VolumeId, err)
+	}
+
+	log.WithField("id", req.VolumeId).Info("deleted volume")
+
+	return &csi.DeleteVolumeResponse{}, nil
+}
@@ -0,0 +1,46 @@
+package service
+
+const (
+	// EnvVarDataDir is the name of the environment variable used to
+	// specify the path to the directory in which all of the driver's
+	// relative directories and volumes are stored.
+	EnvVarDataDir = "X_CSI_VFS_DATA"
+
+	// EnvVarDevDir is the name of the environment variable used to
+	// specify the path to the directory used to store loopback devices.
+	EnvVarDevDir = "X_CSI_VFS_DEV"
+
+	// EnvVarMntDir is the name of the environment variable used to
+	// specify the path to the directory used to bind mount volumes.
+	EnvVarMntDir = "X_CSI_VFS_MNT"
+
+	// EnvVarVolDir is the name of the environment variable used to
+	// specify the path to the directory in which volumes are stored.
+	EnvVarVolDir = "X_CSI_VFS_VOL"
+
+	// EnvVarVolGlob is the name of the environment variable used to
+	// specify the glob pattern used to discover volumes.
+	EnvVarVolGlob = "X_CSI_VFS_VOLGLOB"
+
+	// EnvVarBindFS is the name of the environment variable used to
+	// specify the path to the bindfs binary.
+	EnvVarBindFS = "X_CSI_VFS_BINDFS"
+
+	// EnvVarDockerPlugin is the name of the environment variable used to
+	// enable the Docker Volume Plugin endpoint alongside the gRPC
+	// listener. Setting this to "true" causes the provider to wrap the
+	// service in plugin/docker so it also serves the Docker Volume
+	// Plugin HTTP API.
+	EnvVarDockerPlugin = "X_CSI_VFS_DOCKER_PLUGIN"
+
+	// EnvVarEphemeralAllowed is the name of the environment variable
+	// used to enable ephemeral inline volumes. When unset or not
+	// "true", NodePublishVolume rejects requests asking for ephemeral
+	// mode.
+	EnvVarEphemeralAllowed = "X_CSI_VFS_EPHEMERAL"
+
+	// EnvVarMountBackend is the name of the environment variable used to
+	// specify the driver-wide default MountBackend. Individual volumes
+	// may override this via the "mount_backend" create parameter.
+	EnvVarMountBackend = "X_CSI_VFS_MOUNT_BACKEND"
+)
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+// expandRequiredParam is the volume attribute that toggles whether
+// NodeExpandVolume is expected to be invoked by the CO after a successful
+// ControllerExpandVolume call.
+const expandRequiredParam = "expand-required"
+
+func (s *service) ControllerExpandVolume(
+	ctx context.Context,
+	req *csi.ControllerExpandVolumeRequest) (
+	*csi.ControllerExpandVolumeResponse, error) {
+
+	volID := req.VolumeId
+	if volID == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing volume id")
+	}
+
+	capRange := req.CapacityRange
+	if capRange == nil || capRange.RequiredBytes <= 0 {
+		return nil, status.Error(codes.InvalidArgument,
+			"missing required capacity")
+	}
+
+	vol, err := s.getVolume(volID)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeExpansionRequired := vol.Parameters[expandRequiredParam] == "true"
+
+	newSize := capRange.RequiredBytes
+	if newSize <= vol.capacityBytes {
+		return &csi.ControllerExpandVolumeResponse{
+			CapacityBytes:         vol.capacityBytes,
+			NodeExpansionRequired: nodeExpansionRequired,
+		}, nil
+	}
+
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(s.vol, &stat); err != nil {
+		return nil, status.Errorf(codes.Internal,
+			"failed to stat %s: %v", s.vol, err)
+	}
+
+	if delta := newSize - vol.capacityBytes; delta > int64(stat.Bavail)*int64(stat.Bsize) {
+		return nil, status.Errorf(codes.OutOfRange,
+			"insufficient free space at %s to grow volume %s to %d bytes",
+			s.vol, volID, newSize)
+	}
+
+	if err := s.growQuota(ctx, vol, newSize); err != nil {
+		return nil, err
+	}
+
+	vol.capacityBytes = newSize
+	if err := vol.save(); err != nil {
+		return nil, err
+	}
+
+	log.WithFields(map[string]interface{}{
+		"id":   volID,
+		"size": newSize,
+	}).Info("expanded volume")
+
+	return &csi.ControllerExpandVolumeResponse{
+		CapacityBytes:         newSize,
+		NodeExpansionRequired: nodeExpansionRequired,
+	}, nil
+}
+
+func (s *service) NodeExpandVolume(
+	ctx context.Context,
+	req *csi.NodeExpandVolumeRequest) (
+	*csi.NodeExpandVolumeResponse, error) {
+
+	if req.VolumeId == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing volume id")
+	}
+	if req.VolumePath == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing volume path")
+	}
+
+	// Bind mounts expose the underlying filesystem directly, so there is
+	// no node-local filesystem to grow; the new capacity recorded by
+	// ControllerExpandVolume is already visible at the volume path.
+	return &csi.NodeExpandVolumeResponse{}, nil
+}
@@ -0,0 +1,247 @@
+package service
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/akutz/gofsutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// mountBackendParam is the CreateVolumeRequest parameter that selects a
+// volume's MountBackend, overriding the driver-wide default configured
+// via EnvVarMountBackend.
+const mountBackendParam = "mount_backend"
+
+const (
+	// MountBackendBindFS mounts volumes with the userspace bindfs FUSE
+	// filesystem. This is the original, default behavior.
+	MountBackendBindFS = "bindfs"
+
+	// MountBackendBindMount mounts volumes with the kernel's
+	// `mount --bind`, for root deployments that can't or don't want to
+	// run a FUSE daemon per volume.
+	MountBackendBindMount = "bind"
+
+	// MountBackendFuseOverlayfs publishes volumes with fuse-overlayfs so
+	// that multiple pods sharing a source volume get isolated,
+	// copy-on-write writable views of it.
+	MountBackendFuseOverlayfs = "fuse-overlayfs"
+
+	// MountBackendNFSLoopback exports a volume over NFS and loopback
+	// mounts it back on the same node.
+	MountBackendNFSLoopback = "nfs-loopback"
+)
+
+// BackendCaps describes the properties of a MountBackend.
+type BackendCaps struct {
+	// CopyOnWrite is true if the backend gives each mount its own
+	// writable view of the source rather than a shared one.
+	CopyOnWrite bool
+
+	// RequiresRoot is true if the backend requires CAP_SYS_ADMIN (or
+	// equivalent) rather than being mountable as an unprivileged user.
+	RequiresRoot bool
+}
+
+// MountBackend mounts and unmounts a volume's data directory at a target
+// path. Implementations wrap a particular mount technology (bindfs,
+// mount --bind, fuse-overlayfs, NFS loopback, etc.).
+type MountBackend interface {
+	Mount(ctx context.Context, src, dst string, opts []string) error
+	Unmount(ctx context.Context, dst string) error
+	Capabilities() BackendCaps
+}
+
+// newMountBackend returns the MountBackend registered under name,
+// falling back to the driver-wide default when name is empty.
+func (s *service) newMountBackend(name string) (MountBackend, error) {
+	if name == "" {
+		name = s.mountBackend
+	}
+
+	switch name {
+	case "", MountBackendBindFS:
+		return &bindfsBackend{bin: s.bindfs}, nil
+	case MountBackendBindMount:
+		return &bindMountBackend{}, nil
+	case MountBackendFuseOverlayfs:
+		return &fuseOverlayfsBackend{bin: "fuse-overlayfs"}, nil
+	case MountBackendNFSLoopback:
+		return &nfsLoopbackBackend{exportDir: s.data}, nil
+	default:
+		return nil, status.Errorf(codes.InvalidArgument,
+			"unknown mount backend: %s", name)
+	}
+}
+
+// bindfsBackend mounts volumes with the userspace bindfs FUSE filesystem.
+type bindfsBackend struct {
+	bin string
+}
+
+func (b *bindfsBackend) Mount(
+	ctx context.Context, src, dst string, opts []string) error {
+
+	args := append(append([]string{}, opts...), src, dst)
+	if err := exec.CommandContext(ctx, b.bin, args...).Run(); err != nil {
+		return status.Errorf(codes.Internal,
+			"bindfs: failed to mount %s to %s: %v", src, dst, err)
+	}
+	return nil
+}
+
+func (b *bindfsBackend) Unmount(ctx context.Context, dst string) error {
+	return gofsutil.Unmount(ctx, dst)
+}
+
+func (b *bindfsBackend) Capabilities() BackendCaps {
+	return BackendCaps{}
+}
+
+// bindMountBackend mounts volumes with the kernel's `mount --bind`.
+type bindMountBackend struct{}
+
+func (b *bindMountBackend) Mount(
+	ctx context.Context, src, dst string, opts []string) error {
+
+	return gofsutil.BindMount(ctx, src, dst, opts...)
+}
+
+func (b *bindMountBackend) Unmount(ctx context.Context, dst string) error {
+	return gofsutil.Unmount(ctx, dst)
+}
+
+func (b *bindMountBackend) Capabilities() BackendCaps {
+	return BackendCaps{RequiresRoot: true}
+}
+
+// fuseOverlayfsBackend publishes a copy-on-write view of a volume with
+// fuse-overlayfs, layering an upper/work directory alongside the target so
+// that each mount can write without affecting the shared source or other
+// mounts of the same volume.
+type fuseOverlayfsBackend struct {
+	bin string
+}
+
+func (b *fuseOverlayfsBackend) Mount(
+	ctx context.Context, src, dst string, opts []string) error {
+
+	upper, work := overlayDirs(dst)
+	if err := os.MkdirAll(upper, 0755); err != nil {
+		return status.Errorf(codes.Internal,
+			"fuse-overlayfs: failed to create upperdir %s: %v", upper, err)
+	}
+	if err := os.MkdirAll(work, 0755); err != nil {
+		return status.Errorf(codes.Internal,
+			"fuse-overlayfs: failed to create workdir %s: %v", work, err)
+	}
+
+	overlayOpts := append([]string{
+		"-o", "lowerdir=" + src + ",upperdir=" + upper + ",workdir=" + work,
+	}, opts...)
+	args := append(overlayOpts, dst)
+	if err := exec.CommandContext(ctx, b.bin, args...).Run(); err != nil {
+		return status.Errorf(codes.Internal,
+			"fuse-overlayfs: failed to mount %s to %s: %v", src, dst, err)
+	}
+	return nil
+}
+
+func (b *fuseOverlayfsBackend) Unmount(ctx context.Context, dst string) error {
+	if err := gofsutil.Unmount(ctx, dst); err != nil {
+		return err
+	}
+
+	upper, work := overlayDirs(dst)
+	if err := os.RemoveAll(upper); err != nil {
+		return status.Errorf(codes.Internal,
+			"fuse-overlayfs: failed to remove upperdir %s: %v", upper, err)
+	}
+	if err := os.RemoveAll(work); err != nil {
+		return status.Errorf(codes.Internal,
+			"fuse-overlayfs: failed to remove workdir %s: %v", work, err)
+	}
+	return nil
+}
+
+// overlayDirs returns the upperdir and workdir fuse-overlayfs uses
+// alongside the bind target dst.
+func overlayDirs(dst string) (upper, work string) {
+	return dst + ".upper", dst + ".work"
+}
+
+func (b *fuseOverlayfsBackend) Capabilities() BackendCaps {
+	return BackendCaps{CopyOnWrite: true}
+}
+
+// nfsLoopbackBackend exports a volume's data directory over NFS and
+// loopback mounts it back on the node, exercising the same client path
+// pods would use against a remote NFS server.
+type nfsLoopbackBackend struct {
+	exportDir string
+}
+
+func (b *nfsLoopbackBackend) Mount(
+	ctx context.Context, src, dst string, opts []string) error {
+
+	if err := exec.CommandContext(
+		ctx, "exportfs", "-o", "rw,no_root_squash", "localhost:"+src).Run(); err != nil {
+		return status.Errorf(codes.Internal,
+			"nfs-loopback: failed to export %s: %v", src, err)
+	}
+
+	args := append([]string{"-t", "nfs"}, opts...)
+	args = append(args, "localhost:"+src, dst)
+	if err := exec.CommandContext(ctx, "mount", args...).Run(); err != nil {
+		return status.Errorf(codes.Internal,
+			"nfs-loopback: failed to mount %s to %s: %v", src, dst, err)
+	}
+	return nil
+}
+
+func (b *nfsLoopbackBackend) Unmount(ctx context.Context, dst string) error {
+	src, err := exportedSource(ctx, dst)
+	if err != nil {
+		return status.Errorf(codes.Internal,
+			"nfs-loopback: failed to resolve export for %s: %v", dst, err)
+	}
+
+	if err := gofsutil.Unmount(ctx, dst); err != nil {
+		return err
+	}
+
+	if src == "" {
+		return nil
+	}
+	if err := exec.CommandContext(
+		ctx, "exportfs", "-u", "localhost:"+src).Run(); err != nil {
+		return status.Errorf(codes.Internal,
+			"nfs-loopback: failed to unexport %s: %v", src, err)
+	}
+	return nil
+}
+
+// exportedSource looks up the mount table for dst and returns the
+// loopback-exported source path backing it, with the "localhost:"
+// prefix added by Mount stripped back off. It returns "" if dst isn't
+// currently mounted.
+func exportedSource(ctx context.Context, dst string) (string, error) {
+	mounts, err := getMounts(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, m := range mounts {
+		if m.Path == dst {
+			return strings.TrimPrefix(m.Source, "localhost:"), nil
+		}
+	}
+	return "", nil
+}
+
+func (b *nfsLoopbackBackend) Capabilities() BackendCaps {
+	return BackendCaps{RequiresRoot: true}
+}
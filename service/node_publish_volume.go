@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+const (
+	// ephemeralContextKey is the volume_context key Kubernetes sets on
+	// ephemeral inline volumes, as used by the csi_mounter.
+	ephemeralContextKey = "csi.storage.k8s.io/ephemeral"
+
+	// ephemeralParamKey is the vfs-specific equivalent of
+	// ephemeralContextKey, honored regardless of the CO in use.
+	ephemeralParamKey = "ephemeral"
+)
+
+func isEphemeral(volumeContext map[string]string) bool {
+	return volumeContext[ephemeralContextKey] == "true" ||
+		volumeContext[ephemeralParamKey] == "true"
+}
+
+func (s *service) NodePublishVolume(
+	ctx context.Context,
+	req *csi.NodePublishVolumeRequest) (
+	*csi.NodePublishVolumeResponse, error) {
+
+	volID := req.VolumeId
+	if volID == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing volume id")
+	}
+	target := req.TargetPath
+	if target == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing target path")
+	}
+
+	if isEphemeral(req.VolumeContext) {
+		if !s.ephemeralAllowed {
+			return nil, status.Error(codes.InvalidArgument,
+				"ephemeral inline volumes are not enabled")
+		}
+		if req.StagingTargetPath != "" {
+			return nil, status.Error(codes.InvalidArgument,
+				"ephemeral volumes do not support staging_target_path")
+		}
+		if err := s.createEphemeralVolume(volID, req.VolumeContext); err != nil {
+			return nil, err
+		}
+	}
+
+	vol, err := s.getVolume(volID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return nil, status.Errorf(codes.Internal,
+			"failed to create target path %s: %v", target, err)
+	}
+
+	// A CO may retry NodePublishVolume against a target it already
+	// published; treat that as a no-op rather than mounting a second
+	// time on top of the first.
+	if mounted, err := isMounted(ctx, target); err != nil {
+		return nil, status.Errorf(codes.Internal,
+			"failed to check mounts at %s: %v", target, err)
+	} else if mounted {
+		return &csi.NodePublishVolumeResponse{}, nil
+	}
+
+	backend, err := s.newMountBackend(vol.Parameters[mountBackendParam])
+	if err != nil {
+		return nil, err
+	}
+	if err := backend.Mount(ctx, vol.path, target, nil); err != nil {
+		return nil, err
+	}
+
+	log.WithFields(map[string]interface{}{
+		"id":     volID,
+		"target": target,
+	}).Info("published volume")
+
+	return &csi.NodePublishVolumeResponse{}, nil
+}
+
+func (s *service) NodeUnpublishVolume(
+	ctx context.Context,
+	req *csi.NodeUnpublishVolumeRequest) (
+	*csi.NodeUnpublishVolumeResponse, error) {
+
+	volID := req.VolumeId
+	if volID == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing volume id")
+	}
+	target := req.TargetPath
+	if target == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing target path")
+	}
+
+	vol, err := s.getVolume(volID)
+	if err != nil {
+		return nil, err
+	}
+
+	backend, err := s.newMountBackend(vol.Parameters[mountBackendParam])
+	if err != nil {
+		return nil, err
+	}
+	if err := backend.Unmount(ctx, target); err != nil {
+		return nil, status.Errorf(codes.Internal,
+			"failed to unmount %s: %v", target, err)
+	}
+
+	if vol.Parameters[ephemeralParamKey] == "true" {
+		if err := os.RemoveAll(vol.path); err != nil {
+			return nil, status.Errorf(codes.Internal,
+				"failed to remove ephemeral volume %s: %v", volID, err)
+		}
+	}
+
+	log.WithFields(map[string]interface{}{
+		"id":     volID,
+		"target": target,
+	}).Info("unpublished volume")
+
+	return &csi.NodeUnpublishVolumeResponse{}, nil
+}
+
+// createEphemeralVolume materializes a volume directory and synthetic
+// .info.json on demand, without a prior CreateVolume/ControllerPublishVolume
+// call, so NodePublishVolume can bind mount it directly.
+func (s *service) createEphemeralVolume(
+	volID string, volumeContext map[string]string) error {
+
+	volPath := path.Join(s.vol, volID)
+	if ok, _ := fileExists(volPath); ok {
+		return nil
+	}
+	if err := os.MkdirAll(volPath, 0755); err != nil {
+		return status.Errorf(codes.Internal,
+			"failed to create ephemeral volume %s: %v", volID, err)
+	}
+
+	params := make(map[string]string, len(volumeContext)+1)
+	for k, v := range volumeContext {
+		params[k] = v
+	}
+	params[ephemeralParamKey] = "true"
+
+	vol := &volumeInfo{
+		path:     volPath,
+		infoPath: path.Join(volPath, infoFileName),
+		CreateVolumeRequest: csi.CreateVolumeRequest{
+			Name:       volID,
+			Parameters: params,
+		},
+	}
+	return vol.save()
+}
@@ -0,0 +1,24 @@
+package service
+
+import "testing"
+
+func TestIsEphemeral(t *testing.T) {
+	cases := []struct {
+		name    string
+		context map[string]string
+		want    bool
+	}{
+		{"unset", map[string]string{}, false},
+		{"k8s-ephemeral-key", map[string]string{ephemeralContextKey: "true"}, true},
+		{"vfs-ephemeral-key", map[string]string{ephemeralParamKey: "true"}, true},
+		{"false-value", map[string]string{ephemeralContextKey: "false"}, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := isEphemeral(c.context); got != c.want {
+				t.Fatalf("isEphemeral(%v) = %v, want %v", c.context, got, c.want)
+			}
+		})
+	}
+}
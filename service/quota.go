@@ -0,0 +1,239 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// quotaModeParam is the CreateVolumeRequest parameter that selects a
+// volume's capacity enforcement mode. The effective mode is always
+// reported back in Volume.VolumeContext so consumers can tell whether the
+// reported capacity is advisory or hard-limited.
+const quotaModeParam = "quota_mode"
+
+const (
+	// QuotaModeNone records capacityBytes but does not enforce it.
+	QuotaModeNone = "none"
+
+	// QuotaModeXFSProject enforces capacity with an XFS project quota
+	// on the volume's directory.
+	QuotaModeXFSProject = "xfs_project"
+
+	// QuotaModeLoopback enforces capacity by backing the volume with a
+	// fixed-size loopback filesystem image.
+	QuotaModeLoopback = "loopback"
+)
+
+const (
+	xfsProjectIDParam = "xfs_project_id"
+	quotaSeqFileName  = ".quota-seq"
+)
+
+// applyQuota enforces vol.capacityBytes according to its quota_mode
+// parameter. It is invoked by CreateVolume after the volume directory has
+// been created and before the volume is returned to the caller. It
+// normalizes vol.Parameters[quotaModeParam] to the effective mode so the
+// value is reported back in Volume.VolumeContext even when the caller didn't
+// specify one.
+func (s *service) applyQuota(ctx context.Context, vol *volumeInfo) error {
+	mode := vol.Parameters[quotaModeParam]
+	if mode == "" {
+		mode = QuotaModeNone
+	}
+
+	switch mode {
+	case QuotaModeNone:
+		// No enforcement; capacityBytes remains advisory only.
+	case QuotaModeXFSProject:
+		if err := s.applyXFSProjectQuota(ctx, vol); err != nil {
+			return err
+		}
+	case QuotaModeLoopback:
+		if err := s.applyLoopbackQuota(ctx, vol); err != nil {
+			return err
+		}
+	default:
+		return status.Errorf(codes.InvalidArgument,
+			"unknown quota mode: %s", mode)
+	}
+
+	if vol.Parameters == nil {
+		vol.Parameters = map[string]string{}
+	}
+	vol.Parameters[quotaModeParam] = mode
+	return nil
+}
+
+// teardownQuota reverses whatever applyQuota did for vol, based on its
+// recorded quota_mode. It is invoked by DeleteVolume before the volume
+// directory is removed.
+func (s *service) teardownQuota(ctx context.Context, vol *volumeInfo) error {
+	switch vol.Parameters[quotaModeParam] {
+	case QuotaModeXFSProject:
+		return s.teardownXFSProjectQuota(ctx, vol)
+	case QuotaModeLoopback:
+		return s.teardownLoopbackQuota(ctx, vol)
+	}
+	return nil
+}
+
+func (s *service) applyXFSProjectQuota(ctx context.Context, vol *volumeInfo) error {
+	projectID, err := s.nextProjectID()
+	if err != nil {
+		return status.Errorf(codes.Internal,
+			"failed to allocate xfs project id: %v", err)
+	}
+
+	setCmd := fmt.Sprintf("project -s -p %s %d", vol.path, projectID)
+	if err := exec.CommandContext(
+		ctx, "xfs_quota", "-x", "-c", setCmd, s.vol).Run(); err != nil {
+		return status.Errorf(codes.Internal,
+			"failed to assign xfs project %d to %s: %v", projectID, vol.path, err)
+	}
+
+	limitCmd := fmt.Sprintf("limit -p bhard=%d %d", vol.capacityBytes, projectID)
+	if err := exec.CommandContext(
+		ctx, "xfs_quota", "-x", "-c", limitCmd, s.vol).Run(); err != nil {
+		return status.Errorf(codes.Internal,
+			"failed to set xfs project quota for %s: %v", vol.path, err)
+	}
+
+	if vol.Parameters == nil {
+		vol.Parameters = map[string]string{}
+	}
+	vol.Parameters[xfsProjectIDParam] = strconv.Itoa(projectID)
+	return nil
+}
+
+func (s *service) teardownXFSProjectQuota(ctx context.Context, vol *volumeInfo) error {
+	projectID := vol.Parameters[xfsProjectIDParam]
+	if projectID == "" {
+		return nil
+	}
+
+	limitCmd := fmt.Sprintf("limit -p bhard=0 %s", projectID)
+	if err := exec.CommandContext(
+		ctx, "xfs_quota", "-x", "-c", limitCmd, s.vol).Run(); err != nil {
+		return status.Errorf(codes.Internal,
+			"failed to clear xfs project quota for %s: %v", vol.path, err)
+	}
+	return nil
+}
+
+func (s *service) applyLoopbackQuota(ctx context.Context, vol *volumeInfo) error {
+	imgPath := vol.path + ".img"
+
+	if err := exec.CommandContext(
+		ctx, "fallocate", "-l",
+		strconv.FormatInt(vol.capacityBytes, 10), imgPath).Run(); err != nil {
+		return status.Errorf(codes.Internal,
+			"failed to allocate loopback image %s: %v", imgPath, err)
+	}
+
+	if err := exec.CommandContext(
+		ctx, "mkfs.ext4", "-q", imgPath).Run(); err != nil {
+		return status.Errorf(codes.Internal,
+			"failed to format loopback image %s: %v", imgPath, err)
+	}
+
+	if err := exec.CommandContext(
+		ctx, "mount", "-o", "loop", imgPath, vol.path).Run(); err != nil {
+		return status.Errorf(codes.Internal,
+			"failed to mount loopback image %s at %s: %v",
+			imgPath, vol.path, err)
+	}
+
+	return nil
+}
+
+func (s *service) teardownLoopbackQuota(ctx context.Context, vol *volumeInfo) error {
+	if err := exec.CommandContext(ctx, "umount", vol.path).Run(); err != nil {
+		return status.Errorf(codes.Internal,
+			"failed to unmount loopback image at %s: %v", vol.path, err)
+	}
+
+	imgPath := vol.path + ".img"
+	if err := exec.CommandContext(ctx, "rm", "-f", imgPath).Run(); err != nil {
+		return status.Errorf(codes.Internal,
+			"failed to remove loopback image %s: %v", imgPath, err)
+	}
+	return nil
+}
+
+// growQuota re-applies enforcement for vol's quota_mode at newSize. It is
+// invoked by ControllerExpandVolume once the new size has passed the
+// free-space check, before vol.capacityBytes is set to newSize and
+// persisted.
+func (s *service) growQuota(ctx context.Context, vol *volumeInfo, newSize int64) error {
+	switch vol.Parameters[quotaModeParam] {
+	case QuotaModeXFSProject:
+		return s.growXFSProjectQuota(ctx, vol, newSize)
+	case QuotaModeLoopback:
+		return s.growLoopbackQuota(ctx, vol, newSize)
+	}
+	return nil
+}
+
+func (s *service) growXFSProjectQuota(ctx context.Context, vol *volumeInfo, newSize int64) error {
+	projectID := vol.Parameters[xfsProjectIDParam]
+	if projectID == "" {
+		return nil
+	}
+
+	limitCmd := fmt.Sprintf("limit -p bhard=%d %s", newSize, projectID)
+	if err := exec.CommandContext(
+		ctx, "xfs_quota", "-x", "-c", limitCmd, s.vol).Run(); err != nil {
+		return status.Errorf(codes.Internal,
+			"failed to grow xfs project quota for %s: %v", vol.path, err)
+	}
+	return nil
+}
+
+func (s *service) growLoopbackQuota(ctx context.Context, vol *volumeInfo, newSize int64) error {
+	imgPath := vol.path + ".img"
+
+	if err := exec.CommandContext(
+		ctx, "fallocate", "-l",
+		strconv.FormatInt(newSize, 10), imgPath).Run(); err != nil {
+		return status.Errorf(codes.Internal,
+			"failed to grow loopback image %s: %v", imgPath, err)
+	}
+
+	if err := exec.CommandContext(ctx, "resize2fs", imgPath).Run(); err != nil {
+		return status.Errorf(codes.Internal,
+			"failed to resize loopback filesystem %s: %v", imgPath, err)
+	}
+
+	return nil
+}
+
+// nextProjectID returns the next monotonically increasing XFS project ID,
+// persisting the counter in s.data/.quota-seq. The read-increment-write is
+// serialized with projectIDMu so concurrent CreateVolume calls can't read
+// the same counter value and hand out duplicate project IDs.
+func (s *service) nextProjectID() (int, error) {
+	s.projectIDMu.Lock()
+	defer s.projectIDMu.Unlock()
+
+	seqPath := path.Join(s.data, quotaSeqFileName)
+
+	id := 0
+	if data, err := ioutil.ReadFile(seqPath); err == nil {
+		id, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+	}
+	id++
+
+	if err := ioutil.WriteFile(
+		seqPath, []byte(strconv.Itoa(id)), 0644); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
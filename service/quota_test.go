@@ -0,0 +1,72 @@
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestNextProjectIDMonotonic(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "csi-vfs-quota-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	s := &service{data: dataDir}
+
+	for i := 1; i <= 3; i++ {
+		id, err := s.nextProjectID()
+		if err != nil {
+			t.Fatalf("nextProjectID failed: %v", err)
+		}
+		if id != i {
+			t.Fatalf("nextProjectID = %d, want %d", id, i)
+		}
+	}
+
+	// A fresh service instance backed by the same data dir must resume
+	// from the persisted counter rather than restarting at 1.
+	s2 := &service{data: dataDir}
+	if id, err := s2.nextProjectID(); err != nil {
+		t.Fatalf("nextProjectID failed: %v", err)
+	} else if id != 4 {
+		t.Fatalf("nextProjectID = %d, want 4", id)
+	}
+}
+
+func TestNextProjectIDConcurrent(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "csi-vfs-quota-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	s := &service{data: dataDir}
+
+	const n = 50
+	ids := make([]int, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id, err := s.nextProjectID()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			ids[i] = id
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[int]bool, n)
+	for _, id := range ids {
+		if seen[id] {
+			t.Fatalf("nextProjectID returned duplicate id %d", id)
+		}
+		seen[id] = true
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"path"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/akutz/gofsutil"
 	"github.com/golang/protobuf/jsonpb"
@@ -30,7 +31,7 @@ const (
 	VendorVersion = "0.3.0"
 
 	// SupportedVersions is a list of the CSI versions this SP supports.
-	SupportedVersions = "0.2.0"
+	SupportedVersions = "1.1.0"
 
 	infoFileName = ".info.json"
 )
@@ -44,12 +45,16 @@ type Service interface {
 }
 
 type service struct {
-	bindfs  string
-	data    string
-	dev     string
-	mnt     string
-	vol     string
-	volGlob string
+	bindfs           string
+	data             string
+	dev              string
+	mnt              string
+	vol              string
+	volGlob          string
+	ephemeralAllowed bool
+	mountBackend     string
+
+	projectIDMu sync.Mutex
 }
 
 // New returns a new Service.
@@ -62,12 +67,14 @@ func (s *service) BeforeServe(
 
 	defer func() {
 		log.WithFields(map[string]interface{}{
-			"bindfs":  s.bindfs,
-			"data":    s.data,
-			"dev":     s.dev,
-			"mnt":     s.mnt,
-			"vol":     s.vol,
-			"volGlob": s.volGlob,
+			"bindfs":           s.bindfs,
+			"data":             s.data,
+			"dev":              s.dev,
+			"mnt":              s.mnt,
+			"vol":              s.vol,
+			"volGlob":          s.volGlob,
+			"ephemeralAllowed": s.ephemeralAllowed,
+			"mountBackend":     s.mountBackend,
 		}).Infof("configured %s", Name)
 	}()
 
@@ -143,6 +150,17 @@ func (s *service) BeforeServe(
 		s.bindfs = "bindfs"
 	}
 
+	if v, ok := csictx.LookupEnv(ctx, EnvVarEphemeralAllowed); ok {
+		s.ephemeralAllowed = v == "true"
+	}
+
+	if v, ok := csictx.LookupEnv(ctx, EnvVarMountBackend); ok {
+		s.mountBackend = v
+	}
+	if s.mountBackend == "" {
+		s.mountBackend = MountBackendBindFS
+	}
+
 	// Add an interceptor that validates all requests that include
 	// one or more volume capabilities:
 	//
@@ -164,9 +182,9 @@ type volumeInfo struct {
 
 func (v *volumeInfo) toCSIVolInfo() *csi.Volume {
 	return &csi.Volume{
-		Id:            v.Name,
+		VolumeId:      v.Name,
 		CapacityBytes: v.capacityBytes,
-		Attributes:    v.Parameters,
+		VolumeContext: v.Parameters,
 	}
 }
 
@@ -303,6 +321,22 @@ func getMounts(ctx context.Context) ([]gofsutil.Info, error) {
 	return getMountsObj.GetMounts(ctx)
 }
 
+// isMounted returns true if target already appears as a mount point in
+// the mount table. NodePublishVolume uses this to stay idempotent when
+// the CO retries a publish against a target it already mounted.
+func isMounted(ctx context.Context, target string) (bool, error) {
+	mounts, err := getMounts(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, m := range mounts {
+		if m.Path == target {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 var getMountsObj = &gofsutil.FS{
 	ScanEntry: func(
 		ctx context.Context,
@@ -312,7 +346,8 @@ var getMountsObj = &gofsutil.FS{
 
 		// Validate the mount table entry.
 		validFSType, _ := regexp.MatchString(
-			`(?i)^devtmpfs|(?:fuse\..*)|(?:nfs\d?)|overlay$`, entry.FSType)
+			`(?i)^devtmpfs|(?:fuse\..*)|(?:fuse-overlayfs)|(?:nfs\d?)|overlay$`,
+			entry.FSType)
 		sourceHasSlashPrefix := strings.HasPrefix(entry.MountSource, "/")
 		if valid = validFSType || sourceHasSlashPrefix; !valid {
 			return
@@ -0,0 +1,320 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/ptypes"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+const snapDirName = "snap"
+
+// snapshotInfo is the on-disk representation of a snapshot, modeled
+// after volumeInfo: the csi.Snapshot payload is marshaled with jsonpb so
+// that protobuf field evolution is handled the same way volume metadata
+// already is.
+type snapshotInfo struct {
+	csi.Snapshot
+	sourceVolumeID string
+	path           string
+	infoPath       string
+}
+
+func (v *snapshotInfo) MarshalJSON() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	enc := &jsonpb.Marshaler{}
+	if err := enc.Marshal(buf, &v.Snapshot); err != nil {
+		return nil, status.Errorf(codes.Internal,
+			"failed to marshal snapshot: %v", err)
+	}
+	return json.Marshal(struct {
+		SourceVolumeID string          `json:"source_volume_id"`
+		Snapshot       json.RawMessage `json:"snapshot"`
+	}{
+		SourceVolumeID: v.sourceVolumeID,
+		Snapshot:       buf.Bytes(),
+	})
+}
+
+func (v *snapshotInfo) UnmarshalJSON(data []byte) error {
+	obj := struct {
+		SourceVolumeID string          `json:"source_volume_id"`
+		Snapshot       json.RawMessage `json:"snapshot"`
+	}{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return status.Errorf(codes.Internal,
+			"failed to unmarshal snapshot: %v", err)
+	}
+	rdr := bytes.NewReader(obj.Snapshot)
+	if err := jsonpb.Unmarshal(rdr, &v.Snapshot); err != nil {
+		return status.Errorf(codes.Internal,
+			"failed to unmarshal snapshot: %v", err)
+	}
+	v.sourceVolumeID = obj.SourceVolumeID
+	return nil
+}
+
+func (v *snapshotInfo) save() error {
+	if v.infoPath == "" {
+		return status.Error(codes.Internal,
+			"failed to create snapshot info file: empty path")
+	}
+	f, err := os.Create(v.infoPath)
+	if err != nil {
+		return status.Errorf(codes.Internal,
+			"failed to create snapshot info file: %s: %v", v.infoPath, err)
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(&v)
+}
+
+func (v *snapshotInfo) load() error {
+	if v.infoPath == "" {
+		return status.Error(codes.Internal,
+			"failed to load snapshot info file: empty path")
+	}
+	f, err := os.Open(v.infoPath)
+	if err != nil {
+		return status.Errorf(codes.Internal,
+			"failed to open snapshot info file: %s: %v", v.infoPath, err)
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	return dec.Decode(&v)
+}
+
+func (s *service) snapDir() string {
+	return path.Join(s.data, snapDirName)
+}
+
+func (s *service) getSnapshot(snapID string) (*snapshotInfo, error) {
+	snapPath := path.Join(s.snapDir(), snapID)
+	if ok, err := fileExists(snapPath); !ok {
+		if err != nil {
+			return nil, status.Errorf(codes.NotFound, "%s: %v", snapPath, err)
+		}
+		return nil, status.Error(codes.NotFound, snapPath)
+	}
+
+	infoPath := path.Join(snapPath, infoFileName)
+	snap := &snapshotInfo{path: snapPath, infoPath: infoPath}
+	if err := snap.load(); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+func (s *service) CreateSnapshot(
+	ctx context.Context,
+	req *csi.CreateSnapshotRequest) (
+	*csi.CreateSnapshotResponse, error) {
+
+	if req.SourceVolumeId == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing source volume id")
+	}
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing snapshot name")
+	}
+
+	vol, err := s.getVolume(req.SourceVolumeId)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing, err := s.getSnapshot(req.Name); err == nil {
+		if existing.sourceVolumeID != req.SourceVolumeId {
+			return nil, status.Errorf(codes.AlreadyExists,
+				"snapshot %s already exists for source volume %s",
+				req.Name, existing.sourceVolumeID)
+		}
+		return &csi.CreateSnapshotResponse{Snapshot: &existing.Snapshot}, nil
+	}
+
+	if err := os.MkdirAll(s.snapDir(), 0755); err != nil {
+		return nil, status.Errorf(codes.Internal,
+			"failed to create snapshot directory: %v", err)
+	}
+
+	snapPath := path.Join(s.snapDir(), req.Name)
+	if err := cpAl(vol.path, snapPath); err != nil {
+		return nil, status.Errorf(codes.Internal,
+			"failed to snapshot volume %s: %v", req.SourceVolumeId, err)
+	}
+
+	// The volume's own info file was hardlinked along with its data;
+	// unlink it so saving the snapshot's info file below does not
+	// overwrite the volume's.
+	if err := os.Remove(path.Join(snapPath, infoFileName)); err != nil && !os.IsNotExist(err) {
+		return nil, status.Errorf(codes.Internal,
+			"failed to prepare snapshot %s: %v", req.Name, err)
+	}
+
+	size, err := dirSize(snapPath)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal,
+			"failed to size snapshot %s: %v", req.Name, err)
+	}
+
+	snap := &snapshotInfo{
+		path:           snapPath,
+		infoPath:       path.Join(snapPath, infoFileName),
+		sourceVolumeID: req.SourceVolumeId,
+		Snapshot: csi.Snapshot{
+			SnapshotId:     req.Name,
+			SourceVolumeId: req.SourceVolumeId,
+			SizeBytes:      size,
+			CreationTime:   ptypes.TimestampNow(),
+			ReadyToUse:     true,
+		},
+	}
+	if err := snap.save(); err != nil {
+		return nil, err
+	}
+
+	log.WithFields(map[string]interface{}{
+		"id":     snap.SnapshotId,
+		"source": snap.SourceVolumeId,
+	}).Info("created snapshot")
+
+	return &csi.CreateSnapshotResponse{Snapshot: &snap.Snapshot}, nil
+}
+
+func (s *service) DeleteSnapshot(
+	ctx context.Context,
+	req *csi.DeleteSnapshotRequest) (
+	*csi.DeleteSnapshotResponse, error) {
+
+	if req.SnapshotId == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing snapshot id")
+	}
+
+	snapPath := path.Join(s.snapDir(), req.SnapshotId)
+	if ok, _ := fileExists(snapPath); ok {
+		if err := os.RemoveAll(snapPath); err != nil {
+			return nil, status.Errorf(codes.Internal,
+				"failed to delete snapshot %s: %v", req.SnapshotId, err)
+		}
+	}
+
+	return &csi.DeleteSnapshotResponse{}, nil
+}
+
+func (s *service) ListSnapshots(
+	ctx context.Context,
+	req *csi.ListSnapshotsRequest) (
+	*csi.ListSnapshotsResponse, error) {
+
+	entries, err := filepath.Glob(path.Join(s.snapDir(), "*", infoFileName))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to list snapshots: %v", err)
+	}
+
+	var snaps []*csi.ListSnapshotsResponse_Entry
+	for _, infoPath := range entries {
+		snapID := path.Base(path.Dir(infoPath))
+		snap, err := s.getSnapshot(snapID)
+		if err != nil {
+			continue
+		}
+		snaps = append(snaps, &csi.ListSnapshotsResponse_Entry{
+			Snapshot: &snap.Snapshot,
+		})
+	}
+
+	return &csi.ListSnapshotsResponse{Entries: snaps}, nil
+}
+
+// restoreSnapshot copies the contents of snapshot snapID into destVolPath,
+// the directory of a freshly created volume. It is invoked by CreateVolume
+// when the request honors VolumeContentSource_Snapshot.
+func (s *service) restoreSnapshot(snapID, destVolPath string) error {
+	snap, err := s.getSnapshot(snapID)
+	if err != nil {
+		return err
+	}
+	return copyTree(snap.path, destVolPath, false)
+}
+
+// cpAl recursively copies src to dst, hardlinking regular files the way
+// `cp -al` does and falling back to a byte copy where a link cannot be
+// made. A hardlinked file shares its inode with the source, so an
+// in-place write through either path is visible through both.
+func cpAl(src, dst string) error {
+	return copyTree(src, dst, true)
+}
+
+// copyTree recursively copies src to dst. When link is true, regular
+// files are hardlinked where possible; otherwise they are byte copied.
+func copyTree(src, dst string, link bool) error {
+	return filepath.Walk(src, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := path.Join(dst, rel)
+
+		if fi.IsDir() {
+			return os.MkdirAll(target, fi.Mode())
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			lnk, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(lnk, target)
+		}
+		if link {
+			if err := os.Link(p, target); err == nil {
+				return nil
+			}
+		}
+		return copyFile(p, target, fi.Mode())
+	})
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			size += fi.Size()
+		}
+		return nil
+	})
+	return size, err
+}
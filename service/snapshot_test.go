@@ -0,0 +1,65 @@
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestCpAlAndDirSize(t *testing.T) {
+	src, err := ioutil.TempDir("", "csi-vfs-snap-src-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	if err := os.MkdirAll(path.Join(src, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(src, "a.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(src, "sub", "b.txt"), []byte("world!"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dst, err := ioutil.TempDir("", "csi-vfs-snap-dst-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+	dst = path.Join(dst, "copy")
+
+	if err := cpAl(src, dst); err != nil {
+		t.Fatalf("cpAl failed: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(path.Join(dst, "sub", "b.txt"))
+	if err != nil {
+		t.Fatalf("copied file missing: %v", err)
+	}
+	if string(data) != "world!" {
+		t.Fatalf("unexpected copied contents: %q", data)
+	}
+
+	srcInfo, err := os.Stat(path.Join(src, "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dstInfo, err := os.Stat(path.Join(dst, "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(srcInfo, dstInfo) {
+		t.Fatal("expected cpAl to hardlink regular files")
+	}
+
+	size, err := dirSize(dst)
+	if err != nil {
+		t.Fatalf("dirSize failed: %v", err)
+	}
+	if want := int64(len("hello") + len("world!")); size != want {
+		t.Fatalf("dirSize = %d, want %d", size, want)
+	}
+}